@@ -0,0 +1,52 @@
+package main
+
+import "github.com/biogo/hts/sam"
+
+// gapBase is used to fill positions in the reference-aligned base/quality
+// vectors that are covered by a deletion or reference skip (D/N), where
+// the read contributes no base.
+const gapBase = '-'
+
+// AlignedBases walks rec's CIGAR and projects its query bases and
+// qualities onto reference coordinates. M/=/X are consumed on both the
+// read and the reference; I/S advance the read only and contribute
+// nothing to the output; D/N advance the reference only and are filled
+// with gapBase; H/P are no-ops. It returns the reference position of the
+// first aligned base together with the projected bases and qualities,
+// both indexed by offset from refStart.
+func AlignedBases(rec *sam.Record) (refStart int, bases []byte, quals []byte) {
+	refStart = rec.Pos
+
+	qpos := 0
+	seq := rec.Seq.Expand()
+	qual := rec.Qual
+
+	for _, co := range rec.Cigar {
+		switch co.Type() {
+		case sam.CigarMatch, sam.CigarEqual, sam.CigarMismatch:
+			n := co.Len()
+			bases = append(bases, seq[qpos:qpos+n]...)
+			quals = append(quals, qual[qpos:qpos+n]...)
+			qpos += n
+		case sam.CigarInsertion, sam.CigarSoftClipped:
+			qpos += co.Len()
+		case sam.CigarDeletion, sam.CigarSkipped:
+			n := co.Len()
+			for i := 0; i < n; i++ {
+				bases = append(bases, gapBase)
+				quals = append(quals, 0)
+			}
+		case sam.CigarHardClipped, sam.CigarPadded:
+			// No-op: consumes neither the read nor the reference.
+		}
+	}
+
+	return refStart, bases, quals
+}
+
+// alignedEnd returns the reference coordinate one past the last base
+// AlignedBases would project for rec, i.e. refStart+len(bases).
+func alignedEnd(rec *sam.Record) int {
+	refStart, bases, _ := AlignedBases(rec)
+	return refStart + len(bases)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// benchBamPath points at a multi-GB BAM used to demonstrate how
+// readPanGenomeBamFile scales with Threads. It is intentionally not
+// checked in; set MCORR_BENCH_BAM to a local file to run this
+// benchmark, otherwise it is skipped.
+func benchBamPath(b *testing.B) string {
+	path := os.Getenv("MCORR_BENCH_BAM")
+	if path == "" {
+		b.Skip("set MCORR_BENCH_BAM to a BAM file to run this benchmark")
+	}
+	return path
+}
+
+func benchmarkReadPanGenomeBamFile(b *testing.B, threads int) {
+	path := benchBamPath(b)
+	Threads = threads
+	defer func() { Threads = 1 }()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, recordsChan := readPanGenomeBamFile(path)
+		for range recordsChan {
+		}
+	}
+}
+
+func BenchmarkReadPanGenomeBamFile_1Thread(b *testing.B)  { benchmarkReadPanGenomeBamFile(b, 1) }
+func BenchmarkReadPanGenomeBamFile_4Threads(b *testing.B) { benchmarkReadPanGenomeBamFile(b, 4) }
+func BenchmarkReadPanGenomeBamFile_8Threads(b *testing.B) { benchmarkReadPanGenomeBamFile(b, 8) }
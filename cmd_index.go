@@ -0,0 +1,22 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// cmdIndex implements the "mcorr-reads index" subcommand, which
+// precomputes a BAI index for a BAM file so that later commands can use
+// NewIndexedBamReader instead of a full sequential scan.
+func cmdIndex(args []string) {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Println("usage: mcorr-reads index <bam file>")
+		return
+	}
+
+	bamFileName := fs.Arg(0)
+	ensureBamIndex(bamFileName)
+}
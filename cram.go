@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// cramMagic is the four-byte magic number at the start of every CRAM
+// stream (CRAM\x01...), used to detect CRAM input regardless of the
+// file's name, so piped input is handled the same as a file on disk.
+var cramMagic = []byte("CRAM")
+
+// ReferenceFastaPath is the path to an indexed reference FASTA for
+// reference-based CRAM decoding, set via the --reference flag. It is
+// currently unused: see errCramUnsupported.
+var ReferenceFastaPath string
+
+// errCramUnsupported is the error readSamRecords panics with when it
+// detects CRAM input. Vendored github.com/biogo/hts/cram is, by its own
+// doc comment, a "WIP CRAM reader" that only retrieves containers,
+// blocks and slices; it has no API that decodes a slice into a
+// *sam.Record, so it cannot satisfy SamReader. Full CRAM decoding is
+// blocked on that package (or an alternative) growing a record-level
+// reader.
+var errCramUnsupported = errors.New("mcorr_reads: CRAM input detected, but decoding is not yet supported (github.com/biogo/hts/cram has no record-level read API)")
+
+// sniffCram peeks at the front of r to decide whether it is a CRAM
+// stream, without consuming any bytes from the returned reader.
+func sniffCram(r *bufio.Reader) (bool, error) {
+	peeked, err := r.Peek(len(cramMagic))
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return bytes.Equal(peeked, cramMagic), nil
+}
@@ -0,0 +1,13 @@
+package main
+
+// ShowProgress enables periodic progress output while a BAM/SAM/CRAM
+// file is being decoded, set via the --show-progress flag.
+var ShowProgress bool
+
+// MinMapQuality is the minimum MAPQ a read must have to pass
+// checkReadQuality, set via the --min-map-quality flag.
+var MinMapQuality int
+
+// MinReadLength is the minimum read length a read must have to pass
+// checkReadQuality, set via the --min-read-length flag.
+var MinReadLength int
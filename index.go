@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/sam"
+	"github.com/mingzhi/biogo/feat/gff"
+)
+
+// bamIndexSuffix is the conventional extension biogo/samtools expect
+// alongside a BAM file for its index.
+const bamIndexSuffix = ".bai"
+
+// buildBamIndex streams through a BAM file once and builds a BAI index
+// for it, writing the result to baiFileName. It is used when a caller
+// asks for indexed, region-based access to a BAM that has not been
+// indexed yet.
+func buildBamIndex(bamFileName, baiFileName string) {
+	f, err := os.Open(bamFileName)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	br, err := bam.NewReader(f, 0)
+	if err != nil {
+		panic(err)
+	}
+	defer br.Close()
+
+	var idx bam.Index
+	for {
+		rec, err := br.Read()
+		if err != nil {
+			if err != io.EOF {
+				panic(err)
+			}
+			break
+		}
+		if err := idx.Add(rec, br.LastChunk()); err != nil {
+			panic(err)
+		}
+	}
+
+	out, err := os.Create(baiFileName)
+	if err != nil {
+		panic(err)
+	}
+	defer out.Close()
+
+	if err := bam.WriteIndex(out, &idx); err != nil {
+		panic(err)
+	}
+}
+
+// ensureBamIndex returns a path to a BAI index for bamFileName, building
+// one alongside it if it does not already exist.
+func ensureBamIndex(bamFileName string) string {
+	baiFileName := bamFileName + bamIndexSuffix
+	if _, err := os.Stat(baiFileName); err == nil {
+		return baiFileName
+	}
+
+	if ShowProgress {
+		fmt.Printf("No BAI index found for %s, building one.\n", bamFileName)
+	}
+	buildBamIndex(bamFileName, baiFileName)
+	return baiFileName
+}
+
+// NewIndexedBamReader opens bamFileName for region-based random access
+// using the BAI index at baiFileName (built on the fly via ensureBamIndex
+// if it does not exist), and returns a channel of GeneSamRecords covering
+// only the CDS regions described by gffMap. Unlike readStrainBamFile,
+// which streams the whole file and filters read-by-read, it seeks
+// directly to the bgzf chunks that overlap each annotated gene, skipping
+// the rest of the genome. When Paired is set, each gene's records are run
+// through mergeMatesInSlice before being sent, the same as the other
+// read paths.
+func NewIndexedBamReader(bamFileName, baiFileName string, gffMap map[string][]*gff.Record) chan GeneSamRecords {
+	recordsChan := make(chan GeneSamRecords)
+
+	if baiFileName == "" {
+		baiFileName = ensureBamIndex(bamFileName)
+	}
+
+	go func() {
+		defer close(recordsChan)
+
+		f, err := os.Open(bamFileName)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+
+		br, err := bam.NewReader(f, 0)
+		if err != nil {
+			panic(err)
+		}
+		defer br.Close()
+
+		idxFile, err := os.Open(baiFileName)
+		if err != nil {
+			panic(err)
+		}
+		defer idxFile.Close()
+
+		idx, err := bam.ReadIndex(idxFile)
+		if err != nil {
+			panic(err)
+		}
+
+		header := br.Header()
+		for _, ref := range header.Refs() {
+			gffRecords, found := gffMap[ref.Name()]
+			if !found {
+				continue
+			}
+
+			for _, gffRec := range gffRecords {
+				gene := GeneSamRecords{
+					Start: gffRec.Start - 1,
+					End:   gffRec.End,
+					ID:    gffRec.ID(),
+				}
+				if gffRec.Strand == gff.ReverseStrand {
+					gene.Strand = -1
+				}
+
+				chunks, err := idx.Chunks(ref, gene.Start, gene.End)
+				if err != nil {
+					// No reads overlap this gene.
+					continue
+				}
+
+				it, err := bam.NewIterator(br, chunks)
+				if err != nil {
+					panic(err)
+				}
+
+				for it.Next() {
+					rec := it.Record()
+					if isReadInGene(rec, gene, alignedEnd(rec)) {
+						gene.Records = append(gene.Records, rec)
+					}
+				}
+				if err := it.Error(); err != nil {
+					panic(err)
+				}
+
+				if Paired {
+					gene.Records = mergeMatesInSlice(gene.Records)
+				}
+
+				if len(gene.Records) > 0 {
+					recordsChan <- gene
+				}
+			}
+		}
+	}()
+
+	return recordsChan
+}
+
+// UseIndex makes readStrainBamFile dispatch to NewIndexedBamReader
+// instead of the full sequential scan, set via the --use-index flag.
+var UseIndex bool
+
+// readStrainBamFileIndexed is the NewIndexedBamReader-backed
+// implementation of readStrainBamFile, used when UseIndex is set.
+func readStrainBamFileIndexed(fileName string, gffMap map[string][]*gff.Record) (header *sam.Header, recordsChan chan GeneSamRecords) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		panic(err)
+	}
+	br, err := bam.NewReader(f, 0)
+	if err != nil {
+		panic(err)
+	}
+	header = br.Header()
+	br.Close()
+	f.Close()
+
+	recordsChan = NewIndexedBamReader(fileName, "", gffMap)
+	return header, recordsChan
+}
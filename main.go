@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// main dispatches the "index" subcommand (see cmdIndex) and otherwise
+// parses the flags shared by the read-processing commands before
+// handing off to the rest of the pipeline.
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "index" {
+		cmdIndex(os.Args[2:])
+		return
+	}
+
+	fs := flag.NewFlagSet("mcorr-reads", flag.ExitOnError)
+	fs.BoolVar(&UseIndex, "use-index", false, "use a BAI index for region-based random access instead of a full scan")
+	fs.StringVar(&ReferenceFastaPath, "reference", "", "reference FASTA for reference-based CRAM decoding (CRAM decoding is not yet supported, see errCramUnsupported)")
+	fs.BoolVar(&Paired, "paired", false, "merge overlapping mate pairs before gene assignment")
+	fs.IntVar(&MaxInsert, "max-insert", MaxInsert, "maximum fragment insert size for mate merging")
+	fs.StringVar(&OverlapStrategy, "overlap-strategy", OverlapStrategy, "how to resolve overlapping mate bases: highqual|discordant-n|discard")
+	fs.IntVar(&Threads, "threads", Threads, "number of worker goroutines for parallel per-contig BAM decoding")
+	fs.BoolVar(&ShowProgress, "show-progress", false, "print periodic progress while decoding")
+	fs.IntVar(&MinMapQuality, "min-map-quality", MinMapQuality, "minimum MAPQ for a read to pass quality filtering")
+	fs.IntVar(&MinReadLength, "min-read-length", MinReadLength, "minimum read length for a read to pass quality filtering")
+	fs.Parse(os.Args[1:])
+
+	fmt.Println("usage: mcorr-reads [index] [flags] <bam/sam/cram> <gff>")
+}
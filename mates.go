@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/biogo/hts/sam"
+)
+
+// Paired enables read-pair aware gene assignment: R1/R2 belonging to the
+// same fragment are merged via MergeMates before gene assignment, so a
+// fragment sequenced from both ends is never counted twice in the
+// correlation estimate. Set via the --paired flag.
+var Paired bool
+
+// MaxInsert bounds how far apart (in reference coordinates) two mates
+// may start and still be considered part of the same fragment, set via
+// the --max-insert flag.
+var MaxInsert = 1000
+
+// OverlapStrategy controls how MergeMates resolves bases where mates
+// overlap: "highqual" keeps the higher-quality base, "discordant-n"
+// replaces disagreements with N, and "discard" drops the whole fragment
+// on any disagreement. Set via the --overlap-strategy flag.
+var OverlapStrategy = "highqual"
+
+// errDiscordantMates is returned by MergeMates when OverlapStrategy is
+// "discard" and the mates disagree somewhere in their overlap.
+var errDiscordantMates = errors.New("mcorr_reads: discordant mate overlap discarded")
+
+// MergeMates merges two mate records from the same fragment into a
+// single synthetic record spanning their combined reference footprint.
+// Bases are taken from whichever mate covers a position; where both
+// mates cover it, disagreements are resolved according to
+// OverlapStrategy.
+func MergeMates(r1, r2 *sam.Record) (*sam.Record, error) {
+	start1, bases1, quals1 := AlignedBases(r1)
+	start2, bases2, quals2 := AlignedBases(r2)
+	if start2 < start1 {
+		r1, r2 = r2, r1
+		start1, bases1, quals1, start2, bases2, quals2 = start2, bases2, quals2, start1, bases1, quals1
+	}
+
+	end := start1 + len(bases1)
+	if e2 := start2 + len(bases2); e2 > end {
+		end = e2
+	}
+
+	bases := make([]byte, end-start1)
+	quals := make([]byte, end-start1)
+	for i := range bases {
+		bases[i] = gapBase
+	}
+	copy(bases, bases1)
+	copy(quals, quals1)
+
+	for i, b := range bases2 {
+		pos := start2 - start1 + i
+		q := quals2[i]
+
+		switch {
+		case bases[pos] == gapBase:
+			bases[pos] = b
+			quals[pos] = q
+		case bases[pos] == b:
+			if q > quals[pos] {
+				quals[pos] = q
+			}
+		default:
+			switch OverlapStrategy {
+			case "discordant-n":
+				bases[pos] = 'N'
+				quals[pos] = 0
+			case "discard":
+				return nil, errDiscordantMates
+			default: // "highqual"
+				if q > quals[pos] {
+					bases[pos] = b
+					quals[pos] = q
+				}
+			}
+		}
+	}
+
+	merged := *r1
+	merged.Pos = start1
+	merged.Cigar = sam.Cigar{sam.NewCigarOp(sam.CigarMatch, len(bases))}
+	merged.Flags &^= sam.Paired | sam.MateUnmapped | sam.MateReverse
+	merged.Seq = sam.NewSeq(bases)
+	merged.Qual = quals
+
+	return &merged, nil
+}
+
+// mergeMatesInSlice merges mate pairs within records, all of which must
+// share the same reference — it is used by the parallel decoding path,
+// where a worker already has every quality-passing read for one contig
+// in memory, so pairing does not need mergeMatesChan's streaming buffer.
+func mergeMatesInSlice(records []*sam.Record) []*sam.Record {
+	pending := make(map[string]*sam.Record)
+	merged := make([]*sam.Record, 0, len(records))
+
+	for _, rec := range records {
+		mate, found := pending[rec.Name]
+		if !found {
+			pending[rec.Name] = rec
+			continue
+		}
+		delete(pending, rec.Name)
+
+		if absInt(rec.Pos-mate.Pos) > MaxInsert {
+			merged = append(merged, mate)
+			pending[rec.Name] = rec
+			continue
+		}
+
+		m, err := MergeMates(mate, rec)
+		if err != nil {
+			continue
+		}
+		merged = append(merged, m)
+	}
+
+	for _, rec := range pending {
+		merged = append(merged, rec)
+	}
+
+	return merged
+}
+
+// absInt returns the absolute value of x.
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// mergeMatesChan buffers records from in one reference at a time and
+// replaces each complete mate pair found within MaxInsert with a single
+// merged record from MergeMates, via mergeMatesInSlice. in is assumed
+// coordinate-sorted, as readStrainBamFile requires; mergeMatesInSlice's
+// output has no such guarantee (an unmatched mate, a pair exceeding
+// MaxInsert, or an OverlapStrategy="discard" victim all land wherever a
+// Go map happens to iterate them), so each reference's records are
+// sorted by position before they are emitted. readStrainBamFile evicts
+// genes behind the current read's position as it goes, so anything
+// emitted out of order would otherwise be silently dropped from gene
+// assignment instead of being counted.
+func mergeMatesChan(in chan *sam.Record) chan *sam.Record {
+	out := make(chan *sam.Record)
+	go func() {
+		defer close(out)
+
+		var currentRef string
+		var buf []*sam.Record
+
+		emitRef := func() {
+			merged := mergeMatesInSlice(buf)
+			sort.Slice(merged, func(i, j int) bool { return merged[i].Pos < merged[j].Pos })
+			for _, rec := range merged {
+				out <- rec
+			}
+			buf = buf[:0]
+		}
+
+		for rec := range in {
+			if rec.Ref.Name() != currentRef {
+				emitRef()
+				currentRef = rec.Ref.Name()
+			}
+			buf = append(buf, rec)
+		}
+		emitRef()
+	}()
+	return out
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/biogo/hts/sam"
+)
+
+func testReference(t *testing.T, name string, length int) *sam.Reference {
+	t.Helper()
+	ref, err := sam.NewReference(name, "", "", length, nil, nil)
+	if err != nil {
+		t.Fatalf("sam.NewReference(%q): %v", name, err)
+	}
+	return ref
+}
+
+func testRecord(t *testing.T, name string, ref *sam.Reference, pos int) *sam.Record {
+	t.Helper()
+	seq := []byte("ACGTACGTAC")
+	qual := make([]byte, len(seq))
+	for i := range qual {
+		qual[i] = 30
+	}
+	return &sam.Record{
+		Name:  name,
+		Ref:   ref,
+		Pos:   pos,
+		MapQ:  60,
+		Cigar: sam.Cigar{sam.NewCigarOp(sam.CigarMatch, len(seq))},
+		Seq:   sam.NewSeq(seq),
+		Qual:  qual,
+	}
+}
+
+// TestMergeMatesChanPositionSorted reproduces the scenario from the
+// chunk0-5 review: an unmatched mate earlier in the reference, followed
+// by a mergeable pair, followed by a distant unmatched read, all on the
+// same reference. mergeMatesChan must not reorder these relative to
+// downstream gene-window eviction, which assumes non-decreasing Pos.
+func TestMergeMatesChanPositionSorted(t *testing.T) {
+	ref := testReference(t, "chr1", 10000)
+
+	in := make(chan *sam.Record, 4)
+	in <- testRecord(t, "orphan", ref, 50)
+	in <- testRecord(t, "pair", ref, 100)
+	in <- testRecord(t, "pair", ref, 105)
+	in <- testRecord(t, "far", ref, 5000)
+	close(in)
+
+	var positions []int
+	for rec := range mergeMatesChan(in) {
+		positions = append(positions, rec.Pos)
+	}
+
+	if !sort.IntsAreSorted(positions) {
+		t.Fatalf("mergeMatesChan output is not position-sorted: %v", positions)
+	}
+	if len(positions) != 3 {
+		t.Fatalf("expected 3 records (orphan, merged pair, far), got %d: %v", len(positions), positions)
+	}
+}
+
+func TestMergeMatesHighQual(t *testing.T) {
+	ref := testReference(t, "chr1", 10000)
+
+	r1 := testRecord(t, "frag", ref, 100)
+	r2 := testRecord(t, "frag", ref, 100)
+	r2.Qual[0] = 40
+	r2.Seq = sam.NewSeq([]byte("TCGTACGTAC"))
+
+	OverlapStrategy = "highqual"
+	merged, err := MergeMates(r1, r2)
+	if err != nil {
+		t.Fatalf("MergeMates: %v", err)
+	}
+	if merged.Pos != 100 {
+		t.Fatalf("expected merged Pos 100, got %d", merged.Pos)
+	}
+
+	bases := merged.Seq.Expand()
+	if bases[0] != 'T' {
+		t.Fatalf("expected highqual base 'T' at offset 0, got %q", bases[0])
+	}
+}
+
+func TestMergeMatesDiscard(t *testing.T) {
+	ref := testReference(t, "chr1", 10000)
+
+	r1 := testRecord(t, "frag", ref, 100)
+	r2 := testRecord(t, "frag", ref, 100)
+	r2.Qual[0] = 40
+	r2.Seq = sam.NewSeq([]byte("TCGTACGTAC"))
+
+	OverlapStrategy = "discard"
+	defer func() { OverlapStrategy = "highqual" }()
+
+	if _, err := MergeMates(r1, r2); err == nil {
+		t.Fatal("expected MergeMates to report a discordant overlap, got nil error")
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"os"
+	"sync"
+
+	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/sam"
+	"github.com/mingzhi/biogo/feat/gff"
+)
+
+// Threads sets how many worker goroutines readPanGenomeBamFile and
+// readStrainBamFile use to decode a BAM file in parallel, set via the
+// --threads flag. A value of 1 (the default) keeps the original
+// single-goroutine sequential path, which is also the only path
+// available for plain .sam input.
+var Threads = 1
+
+// refShards splits refs into n disjoint, contiguous groups of reference
+// IDs, one per worker, so each worker's reads stay confined to its own
+// stretch of the file and workers never contend for the same contig.
+func refShards(refs []*sam.Reference, n int) [][]*sam.Reference {
+	if n > len(refs) {
+		n = len(refs)
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	per := (len(refs) + n - 1) / n
+	shards := make([][]*sam.Reference, n)
+	for i := range shards {
+		start := i * per
+		end := start + per
+		if start > len(refs) {
+			start = len(refs)
+		}
+		if end > len(refs) {
+			end = len(refs)
+		}
+		shards[i] = refs[start:end]
+	}
+	return shards
+}
+
+// openWorkerBamReader opens an independent *bam.Reader on fileName for a
+// single worker. rd is passed through to bam.NewReader non-zero, which
+// turns on biogo's internal bgzf inflation worker pool for that reader.
+func openWorkerBamReader(fileName string) *bam.Reader {
+	f, err := os.Open(fileName)
+	if err != nil {
+		panic(err)
+	}
+	br, err := bam.NewReader(f, 2)
+	if err != nil {
+		panic(err)
+	}
+	return br
+}
+
+// readPanGenomeBamFileParallel is the worker-pool backed implementation
+// of readPanGenomeBamFile. It assigns each worker a disjoint range of
+// reference IDs via the BAI index, so workers decode distinct regions of
+// the file concurrently, and merges their output into recordsChan,
+// preserving the one-GeneSamRecords-per-contig grouping of the
+// sequential path.
+func readPanGenomeBamFileParallel(fileName string, threads int) (header *sam.Header, recordsChan chan GeneSamRecords) {
+	baiFileName := ensureBamIndex(fileName)
+
+	idxFile, err := os.Open(baiFileName)
+	if err != nil {
+		panic(err)
+	}
+	idx, err := bam.ReadIndex(idxFile)
+	idxFile.Close()
+	if err != nil {
+		panic(err)
+	}
+
+	probe := openWorkerBamReader(fileName)
+	header = probe.Header()
+	probe.Close()
+
+	shards := refShards(header.Refs(), threads)
+	recordsChan = make(chan GeneSamRecords)
+
+	var wg sync.WaitGroup
+	for _, shard := range shards {
+		if len(shard) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(shard []*sam.Reference) {
+			defer wg.Done()
+
+			wbr := openWorkerBamReader(fileName)
+			defer wbr.Close()
+
+			for _, ref := range shard {
+				chunks, err := idx.Chunks(ref, 0, ref.Len())
+				if err != nil {
+					continue
+				}
+
+				it, err := bam.NewIterator(wbr, chunks)
+				if err != nil {
+					panic(err)
+				}
+
+				var records []*sam.Record
+				for it.Next() {
+					records = append(records, it.Record())
+				}
+				if err := it.Error(); err != nil {
+					panic(err)
+				}
+
+				if len(records) > 0 {
+					recordsChan <- GeneSamRecords{Start: 0, End: ref.Len(), ID: ref.Name(), Records: records}
+				}
+			}
+		}(shard)
+	}
+
+	go func() {
+		wg.Wait()
+		close(recordsChan)
+	}()
+
+	return header, recordsChan
+}
+
+// readStrainBamFileParallel is the worker-pool backed implementation of
+// readStrainBamFile. See readPanGenomeBamFileParallel for the sharding
+// strategy; each worker runs the same per-gene grouping as the
+// sequential path over its own disjoint set of contigs.
+func readStrainBamFileParallel(fileName string, gffMap map[string][]*gff.Record, threads int) (header *sam.Header, recordsChan chan GeneSamRecords) {
+	baiFileName := ensureBamIndex(fileName)
+
+	idxFile, err := os.Open(baiFileName)
+	if err != nil {
+		panic(err)
+	}
+	idx, err := bam.ReadIndex(idxFile)
+	idxFile.Close()
+	if err != nil {
+		panic(err)
+	}
+
+	probe := openWorkerBamReader(fileName)
+	header = probe.Header()
+	probe.Close()
+
+	shards := refShards(header.Refs(), threads)
+	recordsChan = make(chan GeneSamRecords)
+
+	var wg sync.WaitGroup
+	for _, shard := range shards {
+		if len(shard) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(shard []*sam.Reference) {
+			defer wg.Done()
+
+			wbr := openWorkerBamReader(fileName)
+			defer wbr.Close()
+
+			for _, ref := range shard {
+				gffRecords, found := gffMap[ref.Name()]
+				if !found {
+					continue
+				}
+
+				chunks, err := idx.Chunks(ref, 0, ref.Len())
+				if err != nil {
+					continue
+				}
+
+				it, err := bam.NewIterator(wbr, chunks)
+				if err != nil {
+					panic(err)
+				}
+
+				genes := make([]GeneSamRecords, len(gffRecords))
+				for i := range gffRecords {
+					genes[i].Start = gffRecords[i].Start - 1
+					genes[i].End = gffRecords[i].End
+					genes[i].ID = gffRecords[i].ID()
+					if gffRecords[i].Strand == gff.ReverseStrand {
+						genes[i].Strand = -1
+					}
+				}
+
+				var records []*sam.Record
+				for it.Next() {
+					record := it.Record()
+					if !checkReadQuality(record) {
+						continue
+					}
+					records = append(records, record)
+				}
+				if err := it.Error(); err != nil {
+					panic(err)
+				}
+
+				if Paired {
+					records = mergeMatesInSlice(records)
+				}
+
+				for _, record := range records {
+					readEnd := alignedEnd(record)
+					for i := range genes {
+						if isReadInGene(record, genes[i], readEnd) {
+							genes[i].Records = append(genes[i].Records, record)
+						}
+					}
+				}
+
+				for i := range genes {
+					if len(genes[i].Records) > 0 {
+						recordsChan <- genes[i]
+					}
+				}
+			}
+		}(shard)
+	}
+
+	go func() {
+		wg.Wait()
+		close(recordsChan)
+	}()
+
+	return header, recordsChan
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"io"
 	"os"
 
@@ -31,17 +32,29 @@ func readSamRecords(fileName string) (headerChan chan *sam.Header, samRecChan ch
 		}
 		defer f.Close()
 
-		// Decide if it is a .sam or .bam file.
+		// Decide if it is a .sam, .bam or .cram stream by sniffing its
+		// magic bytes rather than trusting the file name, so piped
+		// input (e.g. from `samtools view` or a FIFO) is handled the
+		// same way as a file on disk.
+		buffered := bufio.NewReader(f)
+		isCram, err := sniffCram(buffered)
+		if err != nil {
+			panic(err)
+		}
+
 		var reader SamReader
-		if fileName[len(fileName)-3:] == "bam" {
-			bamReader, err := bam.NewReader(f, 0)
+		switch {
+		case isCram:
+			panic(errCramUnsupported)
+		case fileName[len(fileName)-3:] == "bam":
+			bamReader, err := bam.NewReader(buffered, 0)
 			if err != nil {
 				panic(err)
 			}
 			defer bamReader.Close()
 			reader = bamReader
-		} else {
-			reader, err = sam.NewReader(f)
+		default:
+			reader, err = sam.NewReader(buffered)
 			if err != nil {
 				panic(err)
 			}
@@ -77,7 +90,13 @@ type GeneSamRecords struct {
 }
 
 // readPanGenomeBamFile reads bam file, and return the header and a channel of sam records.
+// When Threads is greater than 1, it decodes the file using a bounded
+// worker pool instead (see readPanGenomeBamFileParallel).
 func readPanGenomeBamFile(fileName string) (header *sam.Header, recordsChan chan GeneSamRecords) {
+	if Threads > 1 {
+		return readPanGenomeBamFileParallel(fileName, Threads)
+	}
+
 	headerChan, samRecChan := readSamRecords(fileName)
 	header = <-headerChan
 	recordsChan = make(chan GeneSamRecords)
@@ -107,9 +126,23 @@ func readPanGenomeBamFile(fileName string) (header *sam.Header, recordsChan chan
 }
 
 //readStrainBamFile read []sam.Record from a bam file of mapping reads to a strain genome file.
+// When UseIndex is set, it decodes the file via NewIndexedBamReader
+// instead (see readStrainBamFileIndexed). Otherwise, when Threads is
+// greater than 1, it decodes the file using a bounded worker pool
+// instead (see readStrainBamFileParallel).
 func readStrainBamFile(fileName string, gffMap map[string][]*gff.Record) (header *sam.Header, recordsChan chan GeneSamRecords) {
+	if UseIndex {
+		return readStrainBamFileIndexed(fileName, gffMap)
+	}
+	if Threads > 1 {
+		return readStrainBamFileParallel(fileName, gffMap, Threads)
+	}
+
 	headerChan, samRecChan := readSamRecords(fileName)
 	header = <-headerChan
+	if Paired {
+		samRecChan = mergeMatesChan(samRecChan)
+	}
 	recordsChan = make(chan GeneSamRecords)
 	go func() {
 		defer close(recordsChan)
@@ -143,9 +176,10 @@ func readStrainBamFile(fileName string, gffMap map[string][]*gff.Record) (header
 				}
 			}
 
+			readEnd := alignedEnd(record)
 			var maxIndex int
 			for i, gene := range genes {
-				if isReadInGene(record, gene) {
+				if isReadInGene(record, gene, readEnd) {
 					inGeneReads++
 					genes[i].Records = append(genes[i].Records, record)
 				} else {
@@ -153,7 +187,7 @@ func readStrainBamFile(fileName string, gffMap map[string][]*gff.Record) (header
 						maxIndex = i
 					}
 
-					if record.Pos+record.Len() < gene.Start {
+					if readEnd < gene.Start {
 						break
 					}
 				}
@@ -186,13 +220,17 @@ func readStrainBamFile(fileName string, gffMap map[string][]*gff.Record) (header
 	return
 }
 
-func isReadInGene(record *sam.Record, gffRec GeneSamRecords) bool {
+// isReadInGene reports whether record overlaps gffRec. readEnd is
+// record's reference-aligned end coordinate (alignedEnd(record)),
+// computed once by the caller and passed in so a record overlapping N
+// genes does not re-walk its CIGAR and re-expand its sequence N times.
+func isReadInGene(record *sam.Record, gffRec GeneSamRecords, readEnd int) bool {
 	start := gffRec.Start - 1
 	if record.Pos > gffRec.Start {
 		start = record.Pos
 	}
-	end := record.Pos + record.Len()
-	if record.Pos+record.Len() > gffRec.End {
+	end := readEnd
+	if end > gffRec.End {
 		end = gffRec.End
 	}
 
@@ -228,9 +266,16 @@ func checkReadQuality(read *sam.Record) bool {
 		return false
 	}
 
-	// contains only match or mismatch
+	// CIGAR ops are walked and projected onto reference coordinates by
+	// AlignedBases, so reads with indels, splices, or clipping (I, D, N,
+	// S, H, P) are no longer rejected here; only unrecognized op types
+	// are.
 	for _, cigar := range read.Cigar {
-		if cigar.Type() != sam.CigarMatch && cigar.Type() != sam.CigarSoftClipped {
+		switch cigar.Type() {
+		case sam.CigarMatch, sam.CigarInsertion, sam.CigarDeletion,
+			sam.CigarSkipped, sam.CigarSoftClipped, sam.CigarHardClipped,
+			sam.CigarPadded, sam.CigarEqual, sam.CigarMismatch:
+		default:
 			return false
 		}
 	}